@@ -1,151 +1,296 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/code-ready/crc/pkg/crc/logging"
 	"github.com/code-ready/crc/pkg/crc/machine"
+	"github.com/code-ready/crc/pkg/crc/version"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
-	"github.com/code-ready/crc/pkg/crc/logging"
+// Per-command timeouts. Cluster lifecycle operations can legitimately take
+// minutes (pulling a bundle, booting a VM); read-only queries should never
+// block for long.
+const (
+	longOperationTimeout  = 10 * time.Minute
+	shortOperationTimeout = 5 * time.Second
 )
 
+// CreateAPIServer creates an HTTP API server listening on the given Unix
+// domain socket path.
 func CreateAPIServer(socketPath string, newConfig newConfigFunc, client machine.Client) (CrcAPIServer, error) {
 	listener, err := net.Listen("unix", socketPath)
 	if err != nil {
 		logging.Error("Failed to create socket: ", err.Error())
 		return CrcAPIServer{}, err
 	}
-	return createAPIServerWithListener(listener, newConfig, newHandler(client))
+	apiServer, err := createAPIServerWithListener(listener, newConfig, prometheus.NewRegistry())
+	if err != nil {
+		return CrcAPIServer{}, err
+	}
+	registerBuiltinCommands(apiServer, client)
+	registerVMCollector(apiServer.promRegistry, client)
+	return apiServer, nil
 }
 
-func createAPIServerWithListener(listener net.Listener, newConfig newConfigFunc, handler RequestHandler) (CrcAPIServer, error) {
+// createAPIServerWithListener builds the server against an arbitrary
+// net.Listener and prometheus.Registry so tests can supply their own
+// listener and assert on the resulting counters.
+func createAPIServerWithListener(listener net.Listener, newConfig newConfigFunc, promRegistry *prometheus.Registry) (CrcAPIServer, error) {
 	apiServer := CrcAPIServer{
-		listener:               listener,
-		newConfig:              newConfig,
-		clusterOpsRequestsChan: make(chan clusterOpsRequest, 10),
-		handler:                handler,
+		listener:       listener,
+		newConfig:      newConfig,
+		registry:       newCommandRegistry(),
+		clusterOpsChan: make(chan clusterOpJob, clusterOpsQueueCapacity),
+		inflight:       newInflightRequests(),
+		logs:           newLogBuffer(),
+		metrics:        newMetrics(promRegistry),
+		promRegistry:   promRegistry,
+	}
+	apiServer.server = &http.Server{
+		Handler:     withVersionHeader(apiServer.router()),
+		ConnContext: withPeerUID,
 	}
 	return apiServer, nil
 }
 
+// Serve starts serving the API over the Unix socket until the listener is closed.
 func (api CrcAPIServer) Serve() {
-	go api.handleClusterOperations() // go routine that handles start, stop and delete calls
-	for {
-		conn, err := api.listener.Accept()
-		if err != nil {
-			logging.Error("Error establishing communication: ", err.Error())
-			continue
-		}
-		api.handleConnections(conn) // handle version, status, webconsole, etc. requests
+	go api.runClusterOperations()
+	if err := api.server.Serve(api.listener); err != nil && err != http.ErrServerClosed {
+		logging.Error("Error serving API: ", err.Error())
 	}
 }
 
-func (api CrcAPIServer) handleClusterOperations() {
-	for req := range api.clusterOpsRequestsChan {
-		api.handleRequest(req.command, req.socket)
+func (api CrcAPIServer) router() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", api.handleStart)
+	mux.HandleFunc("/stop", api.handleStop)
+	mux.HandleFunc("/delete", api.handleDelete)
+	mux.HandleFunc("/status", api.handleStatus)
+	mux.HandleFunc("/version", api.handleVersion)
+	mux.HandleFunc("/webconsole", api.handleWebconsole)
+	mux.HandleFunc("/config/", api.handleConfig)
+	mux.HandleFunc("/requests/", api.handleCancelRequest)
+	mux.HandleFunc("/logs", api.handleLogs)
+	mux.HandleFunc("/metrics", api.handleMetrics)
+	return mux
+}
+
+// withCommandContext derives a context bounded by timeout from the request,
+// tags it with a correlation ID, registers it as an in-flight, cancellable
+// operation, and reports the ID via a response header so the client can
+// cancel it later with DELETE /requests/{id} or tail its logs with
+// GET /logs?request_id={id}. The returned release func must be deferred by
+// the caller.
+func (api CrcAPIServer) withCommandContext(w http.ResponseWriter, r *http.Request, timeout time.Duration) (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	ctx, requestID := withCorrelationID(ctx)
+	ctx, release := api.inflight.register(ctx, requestID)
+	w.Header().Set("X-CRC-Request-Id", requestID)
+	return ctx, func() {
+		release()
+		cancel()
 	}
 }
 
-func (api CrcAPIServer) handleRequest(req commandRequest, conn net.Conn) {
-	defer conn.Close()
-	var result string
+// withVersionHeader stamps every response with the daemon's version so CLI
+// clients can detect a protocol/version mismatch with the running daemon.
+func withVersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-CRC-Version", version.GetCRCVersion())
+		next.ServeHTTP(w, r)
+	})
+}
 
+func (api CrcAPIServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var args []string
+	if err := decodeBody(r, &args); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	config, err := api.newConfig()
 	if err != nil {
-		logging.Error(err.Error())
-		result = encodeErrorToJSON(fmt.Sprintf("Failed to initialize new config store: %v", err))
-		writeStringToSocket(conn, result)
-		return
-	}
-
-	switch req.Command {
-	case "start":
-		result = api.handler.Start(config, req.Args)
-	case "stop":
-		result = api.handler.Stop()
-	case "status":
-		result = api.handler.Status()
-	case "delete":
-		result = api.handler.Delete()
-	case "version":
-		result = api.handler.GetVersion()
-	case "setconfig":
-		result = api.handler.SetConfig(config, req.Args)
-	case "unsetconfig":
-		result = api.handler.UnsetConfig(config, req.Args)
-	case "getconfig":
-		result = api.handler.GetConfig(config, req.Args)
-	case "webconsoleurl":
-		result = api.handler.GetWebconsoleInfo()
-	default:
-		result = encodeErrorToJSON(fmt.Sprintf("Unknown command supplied: %s", req.Command))
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
 	}
-	writeStringToSocket(conn, result)
+	ctx, release := api.withCommandContext(w, r, longOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "start", config, args)
+	writeJSON(w, status, body)
 }
 
-func (api CrcAPIServer) handleConnections(conn net.Conn) {
-	inBuffer := make([]byte, 1024)
-	var req commandRequest
-	numBytes, err := conn.Read(inBuffer)
-	if err != nil || numBytes == 0 || numBytes == cap(inBuffer) {
-		logging.Error("Error reading from socket")
+func (api CrcAPIServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
 		return
 	}
-	logging.Debug("Received Request:", string(inBuffer[0:numBytes]))
-	err = json.Unmarshal(inBuffer[0:numBytes], &req)
+	config, err := api.newConfig()
 	if err != nil {
-		logging.Error("Error decoding request: ", err.Error())
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
 		return
 	}
-	// start, stop and delete are slow operations, and change the VM state so they have to run sequentially.
-	// We don't want other operations querying the status of the VM to be blocked by these,
-	// so they are treated by a dedicated go routine
-
-	switch req.Command {
-	case "start", "stop", "delete":
-		// queue new request to channel
-		r := clusterOpsRequest{
-			command: req,
-			socket:  conn,
-		}
-		if !addRequestToChannel(r, api.clusterOpsRequestsChan) {
-			logging.Error("Channel capacity reached, unable to add new request")
-			errMsg := encodeErrorToJSON("Sockets channel capacity reached, unable to add new request")
-			writeStringToSocket(conn, errMsg)
-			conn.Close()
-		}
+	ctx, release := api.withCommandContext(w, r, longOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "stop", config, nil)
+	writeJSON(w, status, body)
+}
 
-	case "status", "version", "setconfig", "getconfig", "unsetconfig", "webconsoleurl":
-		go api.handleRequest(req, conn)
+func (api CrcAPIServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	ctx, release := api.withCommandContext(w, r, longOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "delete", config, nil)
+	writeJSON(w, status, body)
+}
 
-	default:
-		err := encodeErrorToJSON(fmt.Sprintf("Unknown command supplied: %s", req.Command))
-		writeStringToSocket(conn, err)
-		conn.Close()
+func (api CrcAPIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
 	}
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	ctx, release := api.withCommandContext(w, r, shortOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "status", config, nil)
+	writeJSON(w, status, body)
 }
 
-func writeStringToSocket(socket net.Conn, msg string) {
-	var outBuffer bytes.Buffer
-	_, err := outBuffer.WriteString(msg)
+func (api CrcAPIServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	config, err := api.newConfig()
 	if err != nil {
-		logging.Error("Failed writing string to buffer", err.Error())
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	ctx, release := api.withCommandContext(w, r, shortOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "version", config, nil)
+	writeJSON(w, status, body)
+}
+
+func (api CrcAPIServer) handleWebconsole(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
 		return
 	}
-	_, err = socket.Write(outBuffer.Bytes())
+	config, err := api.newConfig()
 	if err != nil {
-		logging.Error("Failed writing string to socket", err.Error())
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
 		return
 	}
+	ctx, release := api.withCommandContext(w, r, shortOperationTimeout)
+	defer release()
+	status, body := api.dispatch(ctx, "webconsoleurl", config, nil)
+	writeJSON(w, status, body)
 }
 
-func addRequestToChannel(req clusterOpsRequest, requestsChan chan clusterOpsRequest) bool {
-	select {
-	case requestsChan <- req:
-		return true
+func (api CrcAPIServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/config/")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "Missing config property")
+		return
+	}
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	ctx, release := api.withCommandContext(w, r, shortOperationTimeout)
+	defer release()
+	switch r.Method {
+	case http.MethodGet:
+		status, body := api.dispatch(ctx, "getconfig", config, []string{key})
+		writeJSON(w, status, body)
+	case http.MethodPut:
+		var value string
+		if err := decodeBody(r, &value); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		status, body := api.dispatch(ctx, "setconfig", config, []string{key, value})
+		writeJSON(w, status, body)
+	case http.MethodDelete:
+		status, body := api.dispatch(ctx, "unsetconfig", config, []string{key})
+		writeJSON(w, status, body)
 	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleCancelRequest cancels an in-flight cluster operation identified by
+// the ID returned in its X-CRC-Request-Id response header, e.g.
+// DELETE /requests/1f3b.... Cancelling is authorized as a privileged command since
+// it can abort another user's in-flight start/stop/delete.
+func (api CrcAPIServer) handleCancelRequest(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodDelete) {
+		return
+	}
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	if err := api.authorize(r.Context(), config, true); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/requests/")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing request id")
+		return
+	}
+	if !api.inflight.cancel(id) {
+		writeError(w, http.StatusNotFound, "No in-flight request with that id")
+		return
+	}
+	writeJSON(w, http.StatusOK, encodeStructToJSON(struct{ Success bool }{Success: true}))
+}
+
+// allowMethod rejects the request with a 405 unless it uses the given method.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		methodNotAllowed(w, method)
 		return false
 	}
+	return true
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, encodeErrorToJSON(msg))
 }
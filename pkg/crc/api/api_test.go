@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeConfig is a minimal in-memory config.Storage used so tests don't need
+// a real on-disk config file.
+type fakeConfig struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func newFakeConfig() *fakeConfig {
+	return &fakeConfig{values: make(map[string]interface{})}
+}
+
+func (c *fakeConfig) Get(key string) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *fakeConfig) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+func (c *fakeConfig) Unset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+}
+
+var _ config.Storage = (*fakeConfig)(nil)
+
+func newTestServer(t *testing.T) CrcAPIServer {
+	t.Helper()
+	apiServer, _ := newTestServerWithConfig(t, newFakeConfig())
+	return apiServer
+}
+
+// newTestServerWithConfig is like newTestServer but hands back the same
+// *fakeConfig the server's handlers will see on every request, so a test can
+// seed allowed-uids (or any other property) before driving the server.
+func newTestServerWithConfig(t *testing.T, cfg *fakeConfig) (CrcAPIServer, *fakeConfig) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	apiServer, err := createAPIServerWithListener(listener, func() (config.Storage, error) {
+		return cfg, nil
+	}, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("failed to create api server: %v", err)
+	}
+	return apiServer, cfg
+}
+
+func TestDispatchUnknownCommand(t *testing.T) {
+	apiServer := newTestServer(t)
+
+	status, body := apiServer.dispatch(context.Background(), "bogus", newFakeConfig(), nil)
+
+	if status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unregistered command, got %d: %s", status, body)
+	}
+}
+
+func TestDispatchRunsRegisteredHandler(t *testing.T) {
+	apiServer := newTestServer(t)
+	apiServer.Register("echo", CommandHandlerFunc(func(_ context.Context, _ config.Storage, args []string) (interface{}, error) {
+		return struct{ Args []string }{Args: args}, nil
+	}), false, false)
+
+	ctx := context.WithValue(context.Background(), peerUIDKey{}, os.Getuid())
+	status, body := apiServer.dispatch(ctx, "echo", newFakeConfig(), []string{"a"})
+
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 from a registered handler, got %d: %s", status, body)
+	}
+}
+
+func TestAuthorizeRejectsUnresolvedPeerCredentials(t *testing.T) {
+	apiServer := newTestServer(t)
+
+	if err := apiServer.authorize(context.Background(), newFakeConfig(), false); err == nil {
+		t.Fatal("expected authorize to reject a request whose peer credentials could not be resolved")
+	}
+}
+
+func TestAuthorizeAllowsDaemonUID(t *testing.T) {
+	apiServer := newTestServer(t)
+	ctx := context.WithValue(context.Background(), peerUIDKey{}, os.Getuid())
+
+	if err := apiServer.authorize(ctx, newFakeConfig(), true); err != nil {
+		t.Fatalf("expected the daemon's own uid to be authorized for a mutating command, got %v", err)
+	}
+}
+
+func TestAuthorizeAllowListIsReadOnly(t *testing.T) {
+	apiServer := newTestServer(t)
+	cfg := newFakeConfig()
+	cfg.Set(allowedUIDsKey, "4242")
+	ctx := context.WithValue(context.Background(), peerUIDKey{}, 4242)
+
+	if err := apiServer.authorize(ctx, cfg, false); err != nil {
+		t.Fatalf("expected an allow-listed uid to be authorized for a read-only command, got %v", err)
+	}
+	if err := apiServer.authorize(ctx, cfg, true); err == nil {
+		t.Fatal("expected an allow-listed uid to be rejected for a mutating command")
+	}
+}
+
+func TestAuthorizeRejectsUnknownUID(t *testing.T) {
+	apiServer := newTestServer(t)
+	ctx := context.WithValue(context.Background(), peerUIDKey{}, 9999)
+
+	if err := apiServer.authorize(ctx, newFakeConfig(), false); err == nil {
+		t.Fatal("expected a uid that is neither the daemon's own nor allow-listed to be rejected")
+	}
+}
+
+func TestInvokeQueueFull(t *testing.T) {
+	apiServer := newTestServer(t)
+	entry := commandEntry{
+		handler:  CommandHandlerFunc(func(_ context.Context, _ config.Storage, _ []string) (interface{}, error) { return nil, nil }),
+		mutating: true,
+	}
+
+	// Fill the queue without starting runClusterOperations so nothing drains it.
+	for i := 0; i < clusterOpsQueueCapacity; i++ {
+		apiServer.clusterOpsChan <- clusterOpJob{entry: entry, ctx: context.Background(), result: make(chan commandResult, 1)}
+	}
+
+	if _, err := apiServer.invoke(context.Background(), entry, newFakeConfig(), nil); !errors.Is(err, errQueueFull) {
+		t.Fatalf("expected errQueueFull once the cluster operations queue is at capacity, got %v", err)
+	}
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	apiServer := newTestServer(t)
+	entry := commandEntry{
+		handler: CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+		mutating: true,
+	}
+
+	go apiServer.runClusterOperations()
+	defer close(apiServer.clusterOpsChan)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := apiServer.invoke(ctx, entry, newFakeConfig(), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded once the caller's context expires, got %v", err)
+	}
+}
+
+func TestHandleStatusRejectsUnauthorizedPeer(t *testing.T) {
+	apiServer := newTestServer(t)
+	apiServer.Register("status", CommandHandlerFunc(func(_ context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		return struct{ OK bool }{OK: true}, nil
+	}), false, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req = req.WithContext(context.WithValue(req.Context(), peerUIDKey{}, 9999))
+	rec := httptest.NewRecorder()
+
+	apiServer.router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a uid not on the allow-list to be forbidden from /status, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleCancelRequestRejectsUnauthorizedPeer(t *testing.T) {
+	apiServer := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/requests/some-id", nil)
+	req = req.WithContext(context.WithValue(req.Context(), peerUIDKey{}, 9999))
+	rec := httptest.NewRecorder()
+
+	apiServer.router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected cancelling a request to require authorization, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleLogsRejectsUnauthorizedPeer(t *testing.T) {
+	apiServer := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/logs", nil)
+	req = req.WithContext(context.WithValue(req.Context(), peerUIDKey{}, 9999))
+	rec := httptest.NewRecorder()
+
+	apiServer.router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected /logs to require authorization, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestHandleConfigRejectsReadOnlyPeer guards against setconfig/unsetconfig
+// being reachable by an allow-listed read-only uid: they don't mutate VM
+// state, but they can rewrite arbitrary daemon config (including
+// allowed-uids itself), so they must be privileged like start/stop/delete.
+func TestHandleConfigRejectsReadOnlyPeer(t *testing.T) {
+	cfg := newFakeConfig()
+	cfg.Set(allowedUIDsKey, "4242")
+	apiServer, _ := newTestServerWithConfig(t, cfg)
+	apiServer.Register("setconfig", CommandHandlerFunc(func(_ context.Context, cfg config.Storage, args []string) (interface{}, error) {
+		cfg.Set(args[0], args[1])
+		return struct{ Success bool }{Success: true}, nil
+	}), false, true)
+	apiServer.Register("unsetconfig", CommandHandlerFunc(func(_ context.Context, cfg config.Storage, args []string) (interface{}, error) {
+		cfg.Unset(args[0])
+		return struct{ Success bool }{Success: true}, nil
+	}), false, true)
+
+	peerCtx := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), peerUIDKey{}, 4242))
+	}
+
+	putReq := peerCtx(httptest.NewRequest(http.MethodPut, "/config/allowed-uids", strings.NewReader(`"1"`)))
+	putRec := httptest.NewRecorder()
+	apiServer.router().ServeHTTP(putRec, putReq)
+	if putRec.Code != http.StatusForbidden {
+		t.Fatalf("expected a read-only allow-listed uid to be forbidden from PUT /config, got %d: %s", putRec.Code, putRec.Body.String())
+	}
+	if cfg.Get(allowedUIDsKey) != "4242" {
+		t.Fatalf("expected allowed-uids to be unchanged, got %v", cfg.Get(allowedUIDsKey))
+	}
+
+	deleteReq := peerCtx(httptest.NewRequest(http.MethodDelete, "/config/allowed-uids", nil))
+	deleteRec := httptest.NewRecorder()
+	apiServer.router().ServeHTTP(deleteRec, deleteReq)
+	if deleteRec.Code != http.StatusForbidden {
+		t.Fatalf("expected a read-only allow-listed uid to be forbidden from DELETE /config, got %d: %s", deleteRec.Code, deleteRec.Body.String())
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+	"github.com/code-ready/crc/pkg/crc/logging"
+)
+
+// allowedUIDsKey is the config property read by authorize. Set it with
+// `crc config set allowed-uids <uid>[,<uid>...]`.
+const allowedUIDsKey = "allowed-uids"
+
+type peerUIDKey struct{}
+type peerPIDKey struct{}
+
+// peerCredentials is what SO_PEERCRED/LOCAL_PEERCRED report about the
+// process on the other end of a Unix domain socket connection.
+type peerCredentials struct {
+	uid int
+	pid int
+}
+
+// withPeerUID resolves the effective uid and pid of the process on the other
+// end of an accepted Unix domain socket connection and attaches them to the
+// connection's context, so every request made over it can be authorized
+// against the caller's identity (and its log lines tied back to the calling
+// process) rather than trusting any local process that can reach the socket.
+// It is wired up as http.Server.ConnContext.
+func withPeerUID(ctx context.Context, conn net.Conn) context.Context {
+	if !peerCredSupported {
+		return ctx
+	}
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	creds, err := peerUID(unixConn)
+	if err != nil {
+		logging.Debug("Failed to resolve peer credentials: ", err.Error())
+		return ctx
+	}
+	ctx = context.WithValue(ctx, peerUIDKey{}, creds.uid)
+	ctx = context.WithValue(ctx, peerPIDKey{}, creds.pid)
+	return ctx
+}
+
+func peerUIDFromContext(ctx context.Context) (int, bool) {
+	uid, ok := ctx.Value(peerUIDKey{}).(int)
+	return uid, ok
+}
+
+func peerPIDFromContext(ctx context.Context) (int, bool) {
+	pid, ok := ctx.Value(peerPIDKey{}).(int)
+	return pid, ok
+}
+
+// errPeerCredentialsUnresolved is returned when the connection's peer uid
+// could not be determined on a platform that does support resolving it, e.g.
+// after a transient syscall failure. Treating "unknown" as "trusted" would
+// make the allow-list a no-op every time resolution happens to fail, so
+// authorize fails closed instead. This is distinct from peerCredSupported
+// being false, where there is no mechanism to resolve credentials at all.
+var errPeerCredentialsUnresolved = errors.New("unable to resolve peer credentials for this connection")
+
+// authorize rejects commands from local users that are neither the daemon's
+// own uid nor on the `allowed-uids` allow-list. Allow-listed uids may only
+// invoke non-privileged (read-only) commands such as status, version,
+// getconfig and webconsoleurl — not setconfig/unsetconfig, which are
+// non-mutating but still privileged since they let a caller rewrite daemon
+// config, including allowed-uids itself.
+//
+// On a platform with no peer-credential mechanism at all (peerCredSupported
+// is false), every connection would otherwise be rejected, including ones
+// from the daemon's own owner, making the daemon unusable there. Since
+// there's no way to enforce the allow-list in that case anyway, authorize
+// falls back to trusting the connection, matching the daemon's behavior
+// before peer-credential authentication existed.
+func (api CrcAPIServer) authorize(ctx context.Context, cfg config.Storage, privileged bool) error {
+	if !peerCredSupported {
+		return nil
+	}
+	uid, ok := peerUIDFromContext(ctx)
+	if !ok {
+		return errPeerCredentialsUnresolved
+	}
+	if uid == os.Getuid() {
+		return nil
+	}
+	if !containsUID(allowedUIDs(cfg), uid) {
+		return fmt.Errorf("uid %d is not allowed to use the crc daemon", uid)
+	}
+	if privileged {
+		return fmt.Errorf("uid %d is only allowed read-only access to the crc daemon", uid)
+	}
+	return nil
+}
+
+func allowedUIDs(cfg config.Storage) []int {
+	if cfg == nil {
+		return nil
+	}
+	raw, ok := cfg.Get(allowedUIDsKey).(string)
+	if !ok || raw == "" {
+		return nil
+	}
+	var uids []int
+	for _, s := range strings.Split(raw, ",") {
+		uid, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+func containsUID(uids []int, uid int) bool {
+	for _, u := range uids {
+		if u == uid {
+			return true
+		}
+	}
+	return false
+}
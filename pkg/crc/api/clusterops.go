@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+)
+
+// clusterOpsQueueCapacity bounds how many mutating commands (start, stop,
+// delete, ...) can be queued while one is already running.
+const clusterOpsQueueCapacity = 10
+
+type clusterOpJob struct {
+	entry  commandEntry
+	ctx    context.Context
+	config config.Storage
+	args   []string
+	result chan commandResult
+}
+
+type commandResult struct {
+	value interface{}
+	err   error
+}
+
+// runClusterOperations serializes mutating commands so that, e.g., a start
+// and a delete can never run against the VM at the same time. Non-mutating
+// commands never go through this queue and can run concurrently.
+func (api CrcAPIServer) runClusterOperations() {
+	for job := range api.clusterOpsChan {
+		value, err := job.entry.handler.Handle(job.ctx, job.config, job.args)
+		job.result <- commandResult{value: value, err: err}
+	}
+}
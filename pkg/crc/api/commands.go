@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+	"github.com/code-ready/crc/pkg/crc/machine"
+)
+
+// CommandHandler implements a single named API command. Handlers register
+// themselves with CrcAPIServer.Register instead of being wired into a
+// hardcoded switch, so out-of-tree code (tests, future commands such as
+// snapshot or bundle-install) can extend the API without touching the
+// connection dispatcher.
+type CommandHandler interface {
+	Handle(ctx context.Context, config config.Storage, args []string) (interface{}, error)
+}
+
+// CommandHandlerFunc adapts a plain function to the CommandHandler interface.
+type CommandHandlerFunc func(ctx context.Context, config config.Storage, args []string) (interface{}, error)
+
+func (f CommandHandlerFunc) Handle(ctx context.Context, config config.Storage, args []string) (interface{}, error) {
+	return f(ctx, config, args)
+}
+
+var errInvalidArgs = errors.New("invalid number of arguments")
+
+// registerBuiltinCommands wires up the commands the daemon has always
+// supported. Out-of-tree code can add further commands with api.Register
+// without touching this function.
+func registerBuiltinCommands(api CrcAPIServer, client machine.Client) {
+	api.Register("start", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, args []string) (interface{}, error) {
+		return client.Start(ctx, args)
+	}), true, true)
+
+	api.Register("stop", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		return client.Stop(ctx)
+	}), true, true)
+
+	api.Register("delete", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		err := client.Delete(ctx)
+		return struct{ Success bool }{Success: true}, err
+	}), true, true)
+
+	api.Register("status", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		return client.Status(ctx)
+	}), false, false)
+
+	api.Register("version", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		return client.GetVersion(ctx)
+	}), false, false)
+
+	api.Register("webconsoleurl", CommandHandlerFunc(func(ctx context.Context, _ config.Storage, _ []string) (interface{}, error) {
+		url, err := client.GetWebconsoleURL(ctx)
+		return struct{ URL string }{URL: url}, err
+	}), false, false)
+
+	// setconfig/unsetconfig don't touch VM state, so they aren't mutating,
+	// but they can rewrite arbitrary daemon config — including allowed-uids
+	// itself — so they must still be privileged.
+	api.Register("setconfig", CommandHandlerFunc(func(_ context.Context, cfg config.Storage, args []string) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errInvalidArgs
+		}
+		cfg.Set(args[0], args[1])
+		return struct{ Success bool }{Success: true}, nil
+	}), false, true)
+
+	api.Register("unsetconfig", CommandHandlerFunc(func(_ context.Context, cfg config.Storage, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errInvalidArgs
+		}
+		cfg.Unset(args[0])
+		return struct{ Success bool }{Success: true}, nil
+	}), false, true)
+
+	api.Register("getconfig", CommandHandlerFunc(func(_ context.Context, cfg config.Storage, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errInvalidArgs
+		}
+		return struct {
+			Property string
+			Value    interface{}
+		}{Property: args[0], Value: cfg.Get(args[0])}, nil
+	}), false, false)
+}
+
+func encodeErrorToJSON(msg string) string {
+	out, _ := json.Marshal(struct {
+		Error string `json:"Error"`
+	}{Error: msg})
+	return string(out)
+}
+
+func encodeStructToJSON(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return encodeErrorToJSON(err.Error())
+	}
+	return string(out)
+}
+
+func toJSON(value interface{}, err error) string {
+	if err != nil {
+		return encodeErrorToJSON(err.Error())
+	}
+	return encodeStructToJSON(value)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/code-ready/crc/pkg/crc/logging"
+	"github.com/google/uuid"
+)
+
+type correlationIDKey struct{}
+
+// withCorrelationID generates a UUID for this request and attaches it to ctx
+// so the log lines this package records for the request (see logCommand) can
+// be grepped by request ID. The context key is unexported, so machine.Client
+// and config code do not read the ID or tag their own log lines with it.
+func withCorrelationID(ctx context.Context) (context.Context, string) {
+	id := uuid.NewString()
+	return context.WithValue(ctx, correlationIDKey{}, id), id
+}
+
+func correlationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// logEntry is one line recorded in the in-memory ring buffer that backs
+// GET /logs, so the crc CLI can show live logs from a long-running start
+// instead of waiting silently on the socket.
+type logEntry struct {
+	timestamp time.Time
+	requestID string
+	line      string
+}
+
+// logBufferCapacity bounds how many log lines are kept in memory for /logs.
+const logBufferCapacity = 1000
+
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{}
+}
+
+func (b *logBuffer) append(requestID, line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, logEntry{timestamp: time.Now(), requestID: requestID, line: line})
+	if len(b.entries) > logBufferCapacity {
+		b.entries = b.entries[len(b.entries)-logBufferCapacity:]
+	}
+}
+
+// since returns the buffered entries recorded at or after since, optionally
+// filtered to a single request ID.
+func (b *logBuffer) since(since time.Time, requestID string) []logEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []logEntry
+	for _, e := range b.entries {
+		if e.timestamp.Before(since) {
+			continue
+		}
+		if requestID != "" && e.requestID != requestID {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// logCommand emits a structured log line for a finished command (key/value
+// fields so it can be grepped by request_id, command or remote_pid) and
+// records it in the in-memory buffer that backs GET /logs.
+func (api CrcAPIServer) logCommand(ctx context.Context, command string, start time.Time, resultStatus string) {
+	remotePID, _ := peerPIDFromContext(ctx)
+	line := fmt.Sprintf(
+		"request_id=%s command=%s remote_pid=%d duration_ms=%d result_status=%s",
+		correlationIDFromContext(ctx), command, remotePID, time.Since(start).Milliseconds(), resultStatus,
+	)
+	logging.Debug(line)
+	api.logs.append(correlationIDFromContext(ctx), line)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// logStreamInterval is how often handleLogs polls the in-memory log buffer
+// for new entries while the client is still connected.
+const logStreamInterval = 500 * time.Millisecond
+
+// handleLogs streams the daemon log, filtered by since and/or request_id, as
+// newline-delimited JSON-free text chunks for as long as the client stays
+// connected. This lets the crc CLI show live logs from a long-running start
+// instead of waiting silently on the socket.
+//
+//	GET /logs?since=2020-01-02T15:04:05Z&request_id=1f3b...
+func (api CrcAPIServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	if err := api.authorize(r.Context(), config, false); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	since := time.Time{}
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid since timestamp: "+err.Error())
+			return
+		}
+		since = parsed
+	}
+	requestID := r.URL.Query().Get("request_id")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(logStreamInterval)
+	defer ticker.Stop()
+	for {
+		entries := api.logs.since(since, requestID)
+		for _, entry := range entries {
+			since = entry.timestamp.Add(time.Nanosecond)
+			fmt.Fprintln(w, entry.line)
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/code-ready/crc/pkg/crc/machine"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// handleMetrics serves the Prometheus text exposition format for api.promRegistry.
+// It is read-only but still routed through authorize, since cluster resource
+// usage (crc_vm_cpus, crc_vm_memory_bytes, ...) shouldn't be readable by a uid
+// that isn't on the allow-list either.
+func (api CrcAPIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	config, err := api.newConfig()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to initialize new config store: "+err.Error())
+		return
+	}
+	if err := api.authorize(r.Context(), config, false); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	promhttp.HandlerFor(api.promRegistry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// metrics are the Prometheus collectors the API server exposes on /metrics.
+type metrics struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queueDepth      prometheus.Gauge
+	queueDropped    prometheus.Counter
+}
+
+func newMetrics(registry *prometheus.Registry) *metrics {
+	m := &metrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crc_api_requests_total",
+			Help: "Total number of crc daemon API requests, by command and result.",
+		}, []string{"command", "result"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "crc_api_request_duration_seconds",
+			Help: "Latency of crc daemon API requests, by command.",
+		}, []string{"command"}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "crc_cluster_ops_queue_depth",
+			Help: "Number of mutating commands currently queued behind an in-flight cluster operation.",
+		}),
+		queueDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "crc_cluster_ops_dropped_total",
+			Help: "Total number of mutating commands rejected because the cluster operations queue was full.",
+		}),
+	}
+	registry.MustRegister(m.requestsTotal, m.requestDuration, m.queueDepth, m.queueDropped)
+	return m
+}
+
+// observe records the outcome of a dispatched command.
+func (m *metrics) observe(command, result string, durationSeconds float64) {
+	m.requestsTotal.WithLabelValues(command, result).Inc()
+	m.requestDuration.WithLabelValues(command).Observe(durationSeconds)
+}
+
+// vmCollector samples VM state from machine.Client.Status on every scrape
+// instead of keeping separately-updated gauges that could drift from reality.
+type vmCollector struct {
+	client machine.Client
+
+	running  *prometheus.Desc
+	cpus     *prometheus.Desc
+	memory   *prometheus.Desc
+	diskUsed *prometheus.Desc
+}
+
+func registerVMCollector(registry *prometheus.Registry, client machine.Client) {
+	registry.MustRegister(&vmCollector{
+		client:   client,
+		running:  prometheus.NewDesc("crc_vm_running", "Whether the crc VM is currently running (1) or not (0).", nil, nil),
+		cpus:     prometheus.NewDesc("crc_vm_cpus", "Number of vCPUs assigned to the crc VM.", nil, nil),
+		memory:   prometheus.NewDesc("crc_vm_memory_bytes", "Memory assigned to the crc VM, in bytes.", nil, nil),
+		diskUsed: prometheus.NewDesc("crc_vm_disk_used_bytes", "Disk space used inside the crc VM, in bytes.", nil, nil),
+	})
+}
+
+func (c *vmCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.running
+	ch <- c.cpus
+	ch <- c.memory
+	ch <- c.diskUsed
+}
+
+func (c *vmCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), shortOperationTimeout)
+	defer cancel()
+	status, err := c.client.Status(ctx)
+	if err != nil {
+		return
+	}
+	running := 0.0
+	if status.Running {
+		running = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(c.running, prometheus.GaugeValue, running)
+	ch <- prometheus.MustNewConstMetric(c.cpus, prometheus.GaugeValue, float64(status.CPUs))
+	ch <- prometheus.MustNewConstMetric(c.memory, prometheus.GaugeValue, float64(status.MemoryBytes))
+	ch <- prometheus.MustNewConstMetric(c.diskUsed, prometheus.GaugeValue, float64(status.DiskUsedBytes))
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsObserveIncrementsRequestCounters(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := newMetrics(registry)
+
+	m.observe("start", "ok", 0.25)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	var sawRequestsTotal bool
+	for _, family := range families {
+		if family.GetName() != "crc_api_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetCounter().GetValue() == 1 {
+				sawRequestsTotal = true
+			}
+		}
+	}
+	if !sawRequestsTotal {
+		t.Fatal("expected crc_api_requests_total to have a sample with value 1 after one observed request")
+	}
+}
+
+func TestHandleMetricsRejectsUnauthorizedPeer(t *testing.T) {
+	apiServer := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req = req.WithContext(context.WithValue(req.Context(), peerUIDKey{}, 9999))
+	rec := httptest.NewRecorder()
+
+	apiServer.router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected /metrics to require authorization like any other read, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,38 @@
+//go:build darwin
+// +build darwin
+
+package api
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredSupported reports whether this platform has a peer-credential
+// mechanism at all; see its doc comment in peercred_linux.go.
+const peerCredSupported = true
+
+// peerUID resolves the effective uid of the process on the other end of a
+// Unix domain socket via LOCAL_PEERCRED. macOS's xucred doesn't carry a pid,
+// so the pid half of peerCredentials is always zero here.
+func peerUID(conn *net.UnixConn) (peerCredentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peerCredentials{}, err
+	}
+
+	var (
+		cred    *unix.Xucred
+		sockErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, sockErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return peerCredentials{}, err
+	}
+	if sockErr != nil {
+		return peerCredentials{}, sockErr
+	}
+	return peerCredentials{uid: int(cred.Uid)}, nil
+}
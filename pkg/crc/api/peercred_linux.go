@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package api
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredSupported reports whether this platform has a peer-credential
+// mechanism at all. authorize treats "unsupported on this platform" (every
+// call fails, including for the daemon's own owner) differently from a
+// transient per-connection resolution failure on a platform that does
+// support it: the latter is still rejected, but the former would otherwise
+// make the daemon unusable, even to its own owner, on every non-Linux/Darwin
+// platform.
+const peerCredSupported = true
+
+// peerUID resolves the effective uid and pid of the process on the other end
+// of a Unix domain socket via SO_PEERCRED.
+func peerUID(conn *net.UnixConn) (peerCredentials, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peerCredentials{}, err
+	}
+
+	var (
+		ucred   *unix.Ucred
+		sockErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		ucred, sockErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return peerCredentials{}, err
+	}
+	if sockErr != nil {
+		return peerCredentials{}, sockErr
+	}
+	return peerCredentials{uid: int(ucred.Uid), pid: int(ucred.Pid)}, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package api
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredSupported is false here: there is no peer-credential mechanism on
+// this platform at all, as distinct from a transient per-connection failure
+// on a platform that does support it. See its doc comment in
+// peercred_linux.go for how authorize treats the two differently.
+const peerCredSupported = false
+
+// peerUID is not implemented on this platform. It is unreachable in practice
+// since withPeerUID and authorize check peerCredSupported first, but is kept
+// so this file still satisfies the same signature as
+// peercred_linux.go/peercred_darwin.go.
+func peerUID(conn *net.UnixConn) (peerCredentials, error) {
+	return peerCredentials{}, errors.New("peer credential authentication is not supported on this platform")
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+)
+
+type commandEntry struct {
+	handler CommandHandler
+	// mutating commands are serialized through the cluster operations queue.
+	mutating bool
+	// privileged commands may only be invoked by the daemon's own uid; uids
+	// on the allowed-uids list are read-only and cannot invoke them. This is
+	// a separate axis from mutating: setconfig
+	// and unsetconfig don't touch VM state (not mutating) but do let a
+	// caller rewrite daemon config, including allowed-uids itself, so they
+	// must still be privileged.
+	privileged bool
+}
+
+// commandRegistry maps command names to their handlers. It replaces the
+// hardcoded switch statements that used to live in handleRequest and
+// handleConnections.
+type commandRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]commandEntry
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{commands: make(map[string]commandEntry)}
+}
+
+// Register adds a named command to the API server. Mutating commands (start,
+// stop, delete, ...) change VM state and are serialized through the cluster
+// operations queue; non-mutating commands are dispatched immediately and may
+// run concurrently with each other and with an in-flight mutating command.
+// Privileged commands may only be invoked by the daemon's own uid; uids on
+// the allowed-uids list are restricted to non-privileged commands. Most mutating commands are also privileged, but a command can be one
+// without the other (setconfig/unsetconfig are privileged but not mutating).
+func (api CrcAPIServer) Register(name string, handler CommandHandler, mutating, privileged bool) {
+	api.registry.mu.Lock()
+	defer api.registry.mu.Unlock()
+	api.registry.commands[name] = commandEntry{handler: handler, mutating: mutating, privileged: privileged}
+}
+
+func (r *commandRegistry) lookup(name string) (commandEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.commands[name]
+	return entry, ok
+}
+
+var errQueueFull = errors.New("cluster operations queue capacity reached, unable to add new request")
+
+// dispatch authorizes and runs the named command, serializing it through the
+// cluster operations queue if it is registered as mutating, logs the outcome
+// under the request's correlation ID, and returns an HTTP status alongside
+// the JSON-encoded result.
+func (api CrcAPIServer) dispatch(ctx context.Context, name string, cfg config.Storage, args []string) (int, string) {
+	start := time.Now()
+
+	entry, ok := api.registry.lookup(name)
+	if !ok {
+		err := fmt.Errorf("unknown command supplied: %s", name)
+		api.logCommand(ctx, name, start, "not_found")
+		return http.StatusNotFound, toJSON(nil, err)
+	}
+
+	if err := api.authorize(ctx, cfg, entry.privileged); err != nil {
+		api.logCommand(ctx, name, start, "forbidden")
+		return http.StatusForbidden, toJSON(nil, err)
+	}
+
+	value, err := api.invoke(ctx, entry, cfg, args)
+
+	status, httpStatus := "ok", http.StatusOK
+	switch {
+	case errors.Is(err, errQueueFull):
+		status, httpStatus = "unavailable", http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		status, httpStatus = "timeout", http.StatusGatewayTimeout
+	case err != nil:
+		status, httpStatus = "error", http.StatusInternalServerError
+	}
+	api.logCommand(ctx, name, start, status)
+	api.metrics.observe(name, status, time.Since(start).Seconds())
+
+	return httpStatus, toJSON(value, err)
+}
+
+func (api CrcAPIServer) invoke(ctx context.Context, entry commandEntry, cfg config.Storage, args []string) (interface{}, error) {
+	if !entry.mutating {
+		return entry.handler.Handle(ctx, cfg, args)
+	}
+
+	result := make(chan commandResult, 1)
+	select {
+	case api.clusterOpsChan <- clusterOpJob{entry: entry, ctx: ctx, config: cfg, args: args, result: result}:
+		api.metrics.queueDepth.Set(float64(len(api.clusterOpsChan)))
+	default:
+		api.metrics.queueDropped.Inc()
+		return nil, errQueueFull
+	}
+
+	select {
+	case res := <-result:
+		api.metrics.queueDepth.Set(float64(len(api.clusterOpsChan)))
+		return res.value, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
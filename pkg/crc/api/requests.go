@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightRequests tracks the cancel functions of in-flight cluster
+// operations so a client can cancel one it no longer wants to wait for, e.g.
+// via DELETE /requests/{id}.
+type inflightRequests struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func newInflightRequests() *inflightRequests {
+	return &inflightRequests{cancels: make(map[string]context.CancelFunc)}
+}
+
+// register wraps ctx with a cancel function and tracks it under id, the
+// request's correlation ID. It returns the derived context and a release func
+// that must be deferred by the caller to stop tracking the request once it
+// completes.
+func (r *inflightRequests) register(ctx context.Context, id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.mu.Lock()
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+
+	release := func() {
+		r.mu.Lock()
+		delete(r.cancels, id)
+		r.mu.Unlock()
+		cancel()
+	}
+	return ctx, release
+}
+
+// cancel cancels the in-flight request with the given ID. It reports whether
+// such a request was found.
+func (r *inflightRequests) cancel(id string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[id]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	cancel()
+	return true
+}
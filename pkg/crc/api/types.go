@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/code-ready/crc/pkg/crc/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CrcAPIServer serves the crc daemon API over a local Unix domain socket.
+type CrcAPIServer struct {
+	listener       net.Listener
+	server         *http.Server
+	newConfig      newConfigFunc
+	registry       *commandRegistry
+	clusterOpsChan chan clusterOpJob
+	inflight       *inflightRequests
+	logs           *logBuffer
+	metrics        *metrics
+	promRegistry   *prometheus.Registry
+}
+
+type newConfigFunc func() (config.Storage, error)